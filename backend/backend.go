@@ -0,0 +1,77 @@
+// Package backend abstracts the directory-listing calls CreateUsage needs
+// behind a small interface, so duflame can walk trees that are not local
+// directories (object stores, remote shares, ...) without CreateUsage itself
+// knowing the difference.
+//
+// Concrete backends register themselves against a URL scheme via Register,
+// typically from an init func in their own package, and are pulled in with a
+// blank import from main so that builds which don't need them stay small.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Entry describes a single child of a directory, as returned by ReadDir.
+// Size and ModTime are only meaningful when IsDir is false.
+type Entry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// DirInfo describes a directory itself, as returned by StatDir. ModTime is
+// used by the incremental cache to decide whether a directory's listing can
+// be reused from a previous run.
+type DirInfo struct {
+	ModTime time.Time
+}
+
+// Backend walks a single root. Paths passed to its methods are whatever Open
+// returned as the root, joined with child names via Join.
+type Backend interface {
+	StatDir(ctx context.Context, path string) (DirInfo, error)
+	ReadDir(ctx context.Context, path string) ([]Entry, error)
+	Join(elem ...string) string
+}
+
+// Factory opens a Backend for a raw -C argument, returning the backend along
+// with the root path to start walking from.
+type Factory func(rawArg string) (b Backend, root string, err error)
+
+var factories = map[string]Factory{}
+
+// Register associates a Factory with a URL scheme, e.g. "s3" for "s3://...".
+// It is meant to be called from an init func.
+func Register(scheme string, factory Factory) {
+	factories[scheme] = factory
+}
+
+// Open resolves rawArg to a Backend and root path, dispatching on its URL
+// scheme. Arguments without a "scheme://" prefix are handled by whichever
+// factory is registered under the "file" scheme.
+func Open(rawArg string) (Backend, string, error) {
+	scheme := "file"
+	if idx := schemeSeparator(rawArg); idx >= 0 {
+		scheme = rawArg[:idx]
+	}
+
+	factory, ok := factories[scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("backend: no backend registered for scheme %q", scheme)
+	}
+
+	return factory(rawArg)
+}
+
+func schemeSeparator(rawArg string) int {
+	for i := 0; i+2 < len(rawArg); i++ {
+		if rawArg[i] == ':' && rawArg[i+1] == '/' && rawArg[i+2] == '/' {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+// Package local implements the backend.Backend interface over the local
+// filesystem, used for bare paths and "file://" URLs.
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guoyk93/duflame/backend"
+)
+
+func init() {
+	backend.Register("file", Open)
+}
+
+// Open strips an optional "file://" prefix and returns a Backend rooted at
+// the remaining path.
+func Open(rawArg string) (backend.Backend, string, error) {
+	root := strings.TrimPrefix(rawArg, "file://")
+	return &Backend{}, root, nil
+}
+
+type Backend struct{}
+
+func (b *Backend) StatDir(_ context.Context, path string) (backend.DirInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return backend.DirInfo{}, err
+	}
+	return backend.DirInfo{ModTime: info.ModTime()}, nil
+}
+
+func (b *Backend) ReadDir(_ context.Context, path string) ([]backend.Entry, error) {
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]backend.Entry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		entry := backend.Entry{
+			Name:  dirEntry.Name(),
+			IsDir: dirEntry.IsDir(),
+		}
+		if !entry.IsDir {
+			info, err := dirEntry.Info()
+			if err != nil {
+				return nil, err
+			}
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *Backend) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
@@ -0,0 +1,154 @@
+// Package webdav implements the backend.Backend interface over WebDAV, used
+// for "webdav://" URLs. It speaks PROPFIND directly over net/http instead of
+// pulling in a WebDAV client library, since duflame only ever needs to list
+// a directory's immediate children and read their sizes and mtimes.
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guoyk93/duflame/backend"
+)
+
+func init() {
+	backend.Register("webdav", Open)
+}
+
+// Open turns a "webdav://host[:port]/path" argument into an HTTP(S) base
+// URL and the root path to start walking from.
+func Open(rawArg string) (backend.Backend, string, error) {
+	u, err := url.Parse(rawArg)
+	if err != nil {
+		return nil, "", fmt.Errorf("webdav: %w", err)
+	}
+
+	u.Scheme = "http"
+	if u.Port() == "443" {
+		u.Scheme = "https"
+	}
+
+	root := u.Path
+	if root == "" {
+		root = "/"
+	}
+
+	base := *u
+	base.Path = ""
+	base.RawQuery = ""
+
+	return &Backend{client: http.DefaultClient, base: base.String()}, root, nil
+}
+
+// Backend walks a WebDAV server rooted at base, using PROPFIND with a Depth
+// header to list a directory or stat it.
+type Backend struct {
+	client *http.Client
+	base   string
+}
+
+func (b *Backend) StatDir(ctx context.Context, dir string) (backend.DirInfo, error) {
+	ms, err := b.propfind(ctx, dir, "0")
+	if err != nil {
+		return backend.DirInfo{}, err
+	}
+	if len(ms.Responses) == 0 {
+		return backend.DirInfo{}, fmt.Errorf("webdav: %s: not found", dir)
+	}
+	return backend.DirInfo{ModTime: parseModTime(ms.Responses[0].Prop.LastModified)}, nil
+}
+
+func (b *Backend) ReadDir(ctx context.Context, dir string) ([]backend.Entry, error) {
+	ms, err := b.propfind(ctx, dir, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	self := path.Clean("/" + dir)
+
+	var entries []backend.Entry
+	for _, resp := range ms.Responses {
+		href, err := url.QueryUnescape(resp.Href)
+		if err != nil {
+			href = resp.Href
+		}
+		href = path.Clean("/" + href)
+		if href == self {
+			continue // PROPFIND always includes the requested directory itself
+		}
+
+		entry := backend.Entry{
+			Name:  path.Base(href),
+			IsDir: resp.Prop.ResourceType.Collection != nil,
+		}
+		if !entry.IsDir {
+			entry.Size, _ = strconv.ParseInt(resp.Prop.ContentLength, 10, 64)
+			entry.ModTime = parseModTime(resp.Prop.LastModified)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *Backend) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// multistatus is the subset of RFC 4918's PROPFIND response body duflame
+// needs out of each child: its href, whether it's a collection, its size
+// and its last-modified time.
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+		Prop struct {
+			ResourceType struct {
+				Collection *struct{} `xml:"collection"`
+			} `xml:"resourcetype"`
+			ContentLength string `xml:"getcontentlength"`
+			LastModified  string `xml:"getlastmodified"`
+		} `xml:"propstat>prop"`
+	} `xml:"response"`
+}
+
+func (b *Backend) propfind(ctx context.Context, dir string, depth string) (multistatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", b.base+path.Clean("/"+dir), nil)
+	if err != nil {
+		return multistatus{}, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return multistatus{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return multistatus{}, fmt.Errorf("webdav: PROPFIND %s: unexpected status %s", dir, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return multistatus{}, err
+	}
+
+	var ms multistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return multistatus{}, fmt.Errorf("webdav: PROPFIND %s: %w", dir, err)
+	}
+	return ms, nil
+}
+
+func parseModTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC1123, strings.TrimSpace(s))
+	return t
+}
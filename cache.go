@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/guoyk93/duflame/backend"
+)
+
+// cacheFormatVersion guards the on-disk layout of CacheRecord. Bump it
+// whenever the record shape changes so stale caches are discarded instead
+// of being misread.
+const cacheFormatVersion = 2
+
+// CacheRecord is the persisted snapshot of a single directory, keyed by its
+// absolute-ish path as passed on the command line. A directory is reused
+// from cache on the next run as long as its ModTime, and the ModTime of
+// every file the record covers, is unchanged.
+type CacheRecord struct {
+	Path            string
+	DirModTime      time.Time
+	AggregatedSize  int64
+	ChildrenNames   []string
+	PerFileSizes    map[string]int64
+	PerFileModTimes map[string]time.Time
+}
+
+// fresh reports whether every file this record remembers still has the same
+// ModTime on disk. A directory's own ModTime only changes when an entry is
+// added, removed or renamed, not when an existing file is edited in place,
+// so a dir-level cache hit alone can't tell a file that grew or shrank
+// without being renamed from one that is genuinely unchanged; this catches
+// that case at the cost of one StatDir per file the record covers.
+func (record *CacheRecord) fresh(ctx context.Context, bk backend.Backend, dir string) bool {
+	for name, modTime := range record.PerFileModTimes {
+		info, err := bk.StatDir(ctx, bk.Join(dir, name))
+		if err != nil || !info.ModTime.Equal(modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheFile is the gob-encoded payload written to the cache path.
+type cacheFile struct {
+	Version int
+	Records []*CacheRecord
+}
+
+// CacheStore holds the previous run's CacheRecords and tracks which of them
+// are still reachable from the current run, so stale entries can be evicted
+// on Save.
+type CacheStore struct {
+	mu      sync.Mutex
+	records map[string]*CacheRecord
+	seen    map[string]bool
+
+	Hits    int64
+	Misses  int64
+	Rewalks int64
+}
+
+// NewCacheStore returns an empty CacheStore, as used when -force is given.
+func NewCacheStore() *CacheStore {
+	return &CacheStore{
+		records: map[string]*CacheRecord{},
+		seen:    map[string]bool{},
+	}
+}
+
+// LoadCacheStore reads a previously saved cache file. A missing or corrupt
+// file is treated as an empty cache rather than an error, since the cache
+// is only ever an optimization.
+func LoadCacheStore(path string) (*CacheStore, error) {
+	cs := NewCacheStore()
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cs, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var cf cacheFile
+	if err := gob.NewDecoder(f).Decode(&cf); err != nil {
+		return NewCacheStore(), nil
+	}
+	if cf.Version != cacheFormatVersion {
+		return NewCacheStore(), nil
+	}
+
+	for _, record := range cf.Records {
+		cs.records[record.Path] = record
+	}
+
+	return cs, nil
+}
+
+// Lookup returns the cached record for dir if it is still fresh, i.e. the
+// directory's current ModTime matches the ModTime recorded last run.
+func (cs *CacheStore) Lookup(dir string, modTime time.Time) (*CacheRecord, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.seen[dir] = true
+
+	record, ok := cs.records[dir]
+	if !ok {
+		atomic.AddInt64(&cs.Misses, 1)
+		return nil, false
+	}
+	if !record.DirModTime.Equal(modTime) {
+		atomic.AddInt64(&cs.Rewalks, 1)
+		return nil, false
+	}
+
+	atomic.AddInt64(&cs.Hits, 1)
+	return record, true
+}
+
+// Demote reclassifies a dir that Lookup just counted as a hit into a
+// rewalk, used when a per-file freshness check (CacheRecord.fresh) catches
+// an in-place edit that the directory-level ModTime comparison alone
+// couldn't see.
+func (cs *CacheStore) Demote() {
+	atomic.AddInt64(&cs.Hits, -1)
+	atomic.AddInt64(&cs.Rewalks, 1)
+}
+
+// Store registers a freshly-walked record, replacing whatever was cached
+// for that path before.
+func (cs *CacheStore) Store(record *CacheRecord) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.seen[record.Path] = true
+	cs.records[record.Path] = record
+}
+
+// Invalidate discards any cached record for path, forcing the next Lookup
+// for it to miss. Used by "serve" mode's rescan endpoint to force a subtree
+// to be re-walked instead of served stale from disk.
+func (cs *CacheStore) Invalidate(path string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	delete(cs.records, path)
+}
+
+// Save evicts records for paths that were not visited during this run and
+// writes the remaining ones to path, then logs hit/miss/rewalk stats.
+func (cs *CacheStore) Save(path string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var (
+		records []*CacheRecord
+		evicted int
+	)
+	for p, record := range cs.records {
+		if !cs.seen[p] {
+			evicted++
+			continue
+		}
+		records = append(records, record)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(cacheFile{Version: cacheFormatVersion, Records: records}); err != nil {
+		return err
+	}
+
+	log.Printf(
+		"cache: %d hits, %d misses, %d rewalks, %d entries evicted",
+		cs.Hits, cs.Misses, cs.Rewalks, evicted,
+	)
+	return nil
+}
+
+// SaveAll writes every record currently in the store to path, without
+// evicting anything. Unlike the one-shot scan that Save is meant for,
+// "serve" mode only ever visits the handful of directories a browsing
+// session happens to drill into, so "not seen this run" says nothing about
+// whether a path still exists; evicting on that basis would throw away
+// perfectly valid records for everything the user hasn't clicked on yet.
+func (cs *CacheStore) SaveAll(path string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	records := make([]*CacheRecord, 0, len(cs.records))
+	for _, record := range cs.records {
+		records = append(records, record)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(cacheFile{Version: cacheFormatVersion, Records: records}); err != nil {
+		return err
+	}
+
+	log.Printf(
+		"cache: %d hits, %d misses, %d rewalks, %d records saved",
+		cs.Hits, cs.Misses, cs.Rewalks, len(records),
+	)
+	return nil
+}
@@ -0,0 +1,44 @@
+// Package format implements duflame's pluggable output formats, selected via
+// "-o type=NAME,dest=PATH" entries on the command line. Each Exporter works
+// from the same Node tree, built once from the compacted Usage tree, so
+// adding a format means adding a file here and registering it from init.
+package format
+
+import "io"
+
+// Node is an output-format-agnostic view of a directory tree, mirroring the
+// shape of main.Usage after compaction.
+type Node struct {
+	Parent  *Node   `json:"-"`
+	Name    string  `json:"name"`
+	Size    int64   `json:"size"`
+	Entries []*Node `json:"entries,omitempty"`
+}
+
+// Meta carries the run metadata some exporters fold into their output,
+// mirroring what the HTML template already shows.
+type Meta struct {
+	Time     string
+	UnixTime int64
+	Hostname string
+	Path     string
+}
+
+// Exporter renders a Node tree to w.
+type Exporter interface {
+	Export(w io.Writer, root *Node, meta Meta) error
+}
+
+var exporters = map[string]Exporter{}
+
+// Register associates an Exporter with the "type=" value used to select it
+// on the command line. It is meant to be called from an init func.
+func Register(name string, exporter Exporter) {
+	exporters[name] = exporter
+}
+
+// Get looks up a previously registered Exporter by name.
+func Get(name string) (Exporter, bool) {
+	e, ok := exporters[name]
+	return e, ok
+}
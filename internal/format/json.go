@@ -0,0 +1,17 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func init() {
+	Register("json", jsonExporter{})
+}
+
+// jsonExporter writes the raw Node tree as-is, for piping into other tools.
+type jsonExporter struct{}
+
+func (jsonExporter) Export(w io.Writer, root *Node, _ Meta) error {
+	return json.NewEncoder(w).Encode(root)
+}
@@ -0,0 +1,47 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func init() {
+	Register("ncdu", ncduExporter{})
+}
+
+// ncduExporter writes the ncdu JSON export format (the "-f" / "-o" file
+// format ncdu itself produces), so a run can be browsed with `ncdu -f`.
+type ncduExporter struct{}
+
+type ncduInfo struct {
+	Name  string `json:"name"`
+	ASize int64  `json:"asize"`
+	DSize int64  `json:"dsize"`
+}
+
+func (ncduExporter) Export(w io.Writer, root *Node, meta Meta) error {
+	payload := []any{
+		1, 2,
+		map[string]any{
+			"progname":  "duflame",
+			"progver":   "1.0",
+			"timestamp": meta.UnixTime,
+		},
+		ncduNode(root),
+	}
+	return json.NewEncoder(w).Encode(payload)
+}
+
+func ncduNode(node *Node) any {
+	info := ncduInfo{Name: node.Name, ASize: node.Size, DSize: node.Size}
+	if len(node.Entries) == 0 {
+		return info
+	}
+
+	dir := make([]any, 0, len(node.Entries)+1)
+	dir = append(dir, info)
+	for _, entry := range node.Entries {
+		dir = append(dir, ncduNode(entry))
+	}
+	return dir
+}
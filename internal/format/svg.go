@@ -0,0 +1,85 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register("svg", svgExporter{})
+}
+
+const (
+	svgWidth     = 1200
+	svgRowHeight = 20
+)
+
+// svgExporter renders a standalone flame graph as SVG, so it can be viewed
+// without the HTML page's JS.
+type svgExporter struct{}
+
+func (svgExporter) Export(w io.Writer, root *Node, _ Meta) error {
+	height := (nodeDepth(root) + 1) * svgRowHeight
+
+	if _, err := fmt.Fprintf(w,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n",
+		svgWidth, height,
+	); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `<rect width="%d" height="%d" fill="white"/>`+"\n", svgWidth, height); err != nil {
+		return err
+	}
+	if err := writeSVGNode(w, root, 0, float64(svgWidth), 0); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w, `</svg>`)
+	return err
+}
+
+func nodeDepth(node *Node) int {
+	var max int
+	for _, entry := range node.Entries {
+		if d := nodeDepth(entry) + 1; d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+func writeSVGNode(w io.Writer, node *Node, x, width float64, depth int) error {
+	y := depth * svgRowHeight
+	color := fmt.Sprintf("hsl(%d, 60%%, 55%%)", (depth*47)%360)
+
+	if _, err := fmt.Fprintf(w,
+		`<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="%s" stroke="white"/>`+"\n",
+		x, y, width, svgRowHeight, color,
+	); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w,
+		`<text x="%.2f" y="%d" clip-path="inset(0)">%s (%s)</text>`+"\n",
+		x+2, y+14, escapeSVGText(node.Name), formatSize(node.Size),
+	); err != nil {
+		return err
+	}
+
+	if node.Size <= 0 || len(node.Entries) == 0 {
+		return nil
+	}
+
+	childX := x
+	for _, entry := range node.Entries {
+		childWidth := width * float64(entry.Size) / float64(node.Size)
+		if err := writeSVGNode(w, entry, childX, childWidth, depth+1); err != nil {
+			return err
+		}
+		childX += childWidth
+	}
+	return nil
+}
+
+func escapeSVGText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
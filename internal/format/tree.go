@@ -0,0 +1,52 @@
+package format
+
+import (
+	"fmt"
+	"io"
+)
+
+func init() {
+	Register("tree", treeExporter{})
+}
+
+// treeExporter writes a Unicode indented tree to w, in the style of the
+// `tree` command, so a run can be piped straight to a terminal.
+type treeExporter struct{}
+
+func (treeExporter) Export(w io.Writer, root *Node, _ Meta) error {
+	if _, err := fmt.Fprintf(w, "%s (%s)\n", root.Name, formatSize(root.Size)); err != nil {
+		return err
+	}
+	return writeTreeEntries(w, root.Entries, "")
+}
+
+func writeTreeEntries(w io.Writer, entries []*Node, prefix string) error {
+	for i, entry := range entries {
+		connector, childPrefix := "├── ", prefix+"│   "
+		if i == len(entries)-1 {
+			connector, childPrefix = "└── ", prefix+"    "
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s%s (%s)\n", prefix, connector, entry.Name, formatSize(entry.Size)); err != nil {
+			return err
+		}
+		if err := writeTreeEntries(w, entry.Entries, childPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
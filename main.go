@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -17,6 +19,12 @@ import (
 	"time"
 
 	"github.com/guoyk93/rg"
+
+	"github.com/guoyk93/duflame/backend"
+	_ "github.com/guoyk93/duflame/backend/local"
+	_ "github.com/guoyk93/duflame/backend/s3"
+	_ "github.com/guoyk93/duflame/backend/webdav"
+	"github.com/guoyk93/duflame/internal/format"
 )
 
 var (
@@ -32,80 +40,202 @@ func serializeAttributes(m map[string]string) template.HTMLAttr {
 	return template.HTMLAttr(strings.Join(items, " "))
 }
 
+// outputTarget is one "-o" entry: a format type and where to write it.
+type outputTarget struct {
+	Type string
+	Dest string
+}
+
+// outputTargets collects repeated "-o" flags, in the style of BuildKit's
+// "--output". A bare value with no "=" is shorthand for "type=html,dest=...".
+type outputTargets []outputTarget
+
+func (o *outputTargets) String() string {
+	return fmt.Sprint([]outputTarget(*o))
+}
+
+func (o *outputTargets) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		*o = append(*o, outputTarget{Type: "html", Dest: value})
+		return nil
+	}
+
+	target := outputTarget{Type: "html"}
+	for _, part := range strings.Split(value, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid -o entry %q", part)
+		}
+		switch kv[0] {
+		case "type":
+			target.Type = kv[1]
+		case "dest":
+			target.Dest = kv[1]
+		default:
+			return fmt.Errorf("invalid -o key %q", kv[0])
+		}
+	}
+	if target.Dest == "" {
+		return fmt.Errorf("-o entry %q is missing dest=", value)
+	}
+
+	*o = append(*o, target)
+	return nil
+}
+
 type Usage struct {
 	Parent  *Usage   `json:"-"`
 	Name    string   `json:"name"`
 	Size    int64    `json:"size"`
 	Entries []*Usage `json:"entries"`
+
+	// cacheRecord is set while this directory is being freshly walked, so
+	// AddSize can keep the record's AggregatedSize in sync as descendants
+	// report their sizes, without a separate finalization pass.
+	cacheRecord *CacheRecord
+
+	// walked is set once this node's own directory listing has been read,
+	// so "serve" mode's lazy walk knows not to re-read it on every request.
+	walked bool
 }
 
 func (u *Usage) AddSize(size int64) {
-	atomic.AddInt64(&u.Size, size)
+	newSize := atomic.AddInt64(&u.Size, size)
+	if u.cacheRecord != nil {
+		atomic.StoreInt64(&u.cacheRecord.AggregatedSize, newSize)
+	}
 	if u.Parent != nil {
 		u.Parent.AddSize(size)
 	}
 }
 
 type CreateUsageOptions struct {
-	Concurrency chan struct{}
-	Dir         string
-	OnError     func(err error, dir string)
-	WaitGroup   *sync.WaitGroup
+	Backend backend.Backend
+	Dir     string
+	OnError func(err error, dir string)
+	Cache   *CacheStore
+	Workers int
 }
 
+// CreateUsage walks the tree rooted at opts.Dir and blocks until it is done.
+// A fixed pool of opts.Workers goroutines drains a shared queue of pending
+// directories, so the number of goroutines stays at the worker count rather
+// than growing with the number of directories. The queue itself is
+// unbounded and holds one job for every directory still waiting to be read.
 func CreateUsage(usage *Usage, opts CreateUsageOptions) {
-	// concurrency control
-	<-opts.Concurrency
-	defer func() {
-		opts.Concurrency <- struct{}{}
-	}()
-	defer opts.WaitGroup.Done()
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+
+	queue := newUsageQueue()
+	pending := int64(1)
+
+	queue.Push(&usageJob{Usage: usage, Dir: opts.Dir})
+
+	var workers sync.WaitGroup
+	workers.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer workers.Done()
+			for {
+				job, ok := queue.Pop()
+				if !ok {
+					return
+				}
+				processUsageJob(job, queue, &pending, opts)
+			}
+		}()
+	}
+	workers.Wait()
+}
+
+// processUsageJob walks a single directory, pushing one job per
+// subdirectory back onto the queue instead of recursing, and decrements
+// pending when this directory (not its subdirectories) is fully accounted
+// for. The queue is closed once pending reaches zero, which is how the
+// worker pool knows there is nothing left to walk.
+func processUsageJob(job *usageJob, queue *usageQueue, pending *int64, opts CreateUsageOptions) {
+	usage := job.Usage
 
-	// error handling
 	var err error
 	defer func() {
-		if err == nil {
-			return
+		if err != nil && opts.OnError != nil {
+			opts.OnError(err, job.Dir)
 		}
-		if opts.OnError != nil {
-			opts.OnError(err, opts.Dir)
+		if atomic.AddInt64(pending, -1) == 0 {
+			queue.Close()
 		}
 	}()
 	defer rg.Guard(&err)
 
-	entries := rg.Must(os.ReadDir(opts.Dir))
+	ctx := context.Background()
+
+	push := func(name string) {
+		subUsage := &Usage{Parent: usage, Name: name}
+		usage.Entries = append(usage.Entries, subUsage)
+		atomic.AddInt64(pending, 1)
+		queue.Push(&usageJob{Usage: subUsage, Dir: opts.Backend.Join(job.Dir, name)})
+	}
+
+	if opts.Cache != nil {
+		dirInfo := rg.Must(opts.Backend.StatDir(ctx, job.Dir))
+
+		if record, ok := opts.Cache.Lookup(job.Dir, dirInfo.ModTime); ok {
+			if record.fresh(ctx, opts.Backend, job.Dir) {
+				for _, size := range record.PerFileSizes {
+					usage.AddSize(size)
+				}
+
+				for _, name := range record.ChildrenNames {
+					if _, isFile := record.PerFileSizes[name]; isFile {
+						continue
+					}
+					push(name)
+				}
+				return
+			}
+			opts.Cache.Demote()
+		}
+
+		usage.cacheRecord = &CacheRecord{
+			Path:            job.Dir,
+			DirModTime:      dirInfo.ModTime,
+			PerFileSizes:    map[string]int64{},
+			PerFileModTimes: map[string]time.Time{},
+		}
+	}
+
+	entries := rg.Must(opts.Backend.ReadDir(ctx, job.Dir))
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir {
 			continue
 		}
 
-		info := rg.Must(entry.Info())
+		usage.AddSize(entry.Size)
 
-		usage.AddSize(info.Size())
+		if usage.cacheRecord != nil {
+			usage.cacheRecord.ChildrenNames = append(usage.cacheRecord.ChildrenNames, entry.Name)
+			usage.cacheRecord.PerFileSizes[entry.Name] = entry.Size
+			usage.cacheRecord.PerFileModTimes[entry.Name] = entry.ModTime
+		}
 	}
 
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !entry.IsDir {
 			continue
 		}
 
-		subUsage := &Usage{
-			Parent: usage,
-			Name:   entry.Name(),
+		if usage.cacheRecord != nil {
+			usage.cacheRecord.ChildrenNames = append(usage.cacheRecord.ChildrenNames, entry.Name)
 		}
-		usage.Entries = append(usage.Entries, subUsage)
 
-		opts.WaitGroup.Add(1)
+		push(entry.Name)
+	}
 
-		go CreateUsage(subUsage, CreateUsageOptions{
-			Concurrency: opts.Concurrency,
-			WaitGroup:   opts.WaitGroup,
-			Dir:         filepath.Join(opts.Dir, entry.Name()),
-			OnError:     opts.OnError,
-		})
+	if usage.cacheRecord != nil {
+		opts.Cache.Store(usage.cacheRecord)
 	}
-	return
 }
 
 func CompactUsage(usage *Usage, maxEntries int, maxDepth int) {
@@ -148,41 +278,11 @@ func CompactUsage(usage *Usage, maxEntries int, maxDepth int) {
 	}
 }
 
-func main() {
-	var (
-		err error
-	)
-
-	defer func() {
-		if err == nil {
-			return
-		}
-		log.Println("exited with error:", err)
-		os.Exit(1)
-	}()
-	defer rg.Guard(&err)
-
-	var (
-		optPath       string
-		optOutput     string
-		optMaxEntries int
-		optMaxDepth   int
-	)
-	flag.StringVar(&optPath, "C", ".", "directory path")
-	flag.StringVar(&optOutput, "o", "duflame.html", "output file path")
-	flag.IntVar(&optMaxEntries, "t", 10, "max entries for each directory")
-	flag.IntVar(&optMaxDepth, "d", 10, "max depth")
-	flag.Parse()
-
-	if optMaxEntries < 1 {
-		optMaxEntries = 1
-	}
-
-	if optMaxDepth < 1 {
-		optMaxDepth = 1
-	}
-
-	tpl := rg.Must(
+// buildTemplate parses the embedded HTML template with the helper funcs the
+// flame graph markup needs. Both the one-shot "html" output and "serve"
+// mode's index page render through the same template.
+func buildTemplate() *template.Template {
+	return rg.Must(
 		template.New("__main__").Funcs(template.FuncMap{
 			"calculateItemAttributes": func(usage *Usage) template.HTMLAttr {
 				attrClass := "flamegraph-item"
@@ -245,42 +345,177 @@ func main() {
 			rg.Must(res.ReadFile("template.gohtml")),
 		)),
 	)
+}
+
+func main() {
+	var (
+		err error
+	)
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		log.Println("exited with error:", err)
+		os.Exit(1)
+	}()
+	defer rg.Guard(&err)
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
+	var (
+		optPath       string
+		optOutputs    outputTargets
+		optMaxEntries int
+		optMaxDepth   int
+		optCache      string
+		optForce      bool
+		optWorkers    int
+	)
+	flag.StringVar(&optPath, "C", ".", "directory path, or a backend URL such as file://path")
+	flag.Var(&optOutputs, "o", "output target, e.g. file.html or type=json,dest=usage.json; repeat for multiple outputs")
+	flag.IntVar(&optMaxEntries, "t", 10, "max entries for each directory")
+	flag.IntVar(&optMaxDepth, "d", 10, "max depth")
+	flag.StringVar(&optCache, "cache", "", "path to a cache file, enables incremental scanning of unchanged directories")
+	flag.BoolVar(&optForce, "force", false, "ignore the existing cache file and re-walk everything")
+	flag.IntVar(&optWorkers, "j", runtime.NumCPU(), "number of worker goroutines walking the tree")
+	flag.Parse()
+
+	if optWorkers < 1 {
+		optWorkers = 1
+	}
+
+	if len(optOutputs) == 0 {
+		optOutputs = append(optOutputs, outputTarget{Type: "html", Dest: "duflame.html"})
+	}
+
+	if optMaxEntries < 1 {
+		optMaxEntries = 1
+	}
 
-	f := rg.Must(os.OpenFile(optOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644))
-	defer f.Close()
+	if optMaxDepth < 1 {
+		optMaxDepth = 1
+	}
+
+	tpl := buildTemplate()
+
+	var (
+		bk   backend.Backend
+		root string
+	)
+	bk, root, err = backend.Open(optPath)
+	if err != nil {
+		return
+	}
 
 	usage := &Usage{
 		Name: "[ROOT]",
 	}
 
-	// concurrency
-	numCPU := runtime.NumCPU()
-	concurrency := make(chan struct{}, numCPU)
-	for i := 0; i < numCPU; i++ {
-		concurrency <- struct{}{}
+	// incremental cache
+	var cache *CacheStore
+	if optCache != "" {
+		if optForce {
+			cache = NewCacheStore()
+		} else {
+			cache = rg.Must(LoadCacheStore(optCache))
+		}
 	}
 
-	// wait group
-	waitGroup := &sync.WaitGroup{}
-	waitGroup.Add(1)
-
 	CreateUsage(usage, CreateUsageOptions{
-		Concurrency: concurrency,
-		WaitGroup:   waitGroup,
-		Dir:         optPath,
+		Backend: bk,
+		Dir:     root,
 		OnError: func(err error, dir string) {
 			log.Println("failed to calculate usage:", err, dir)
 		},
+		Cache:   cache,
+		Workers: optWorkers,
 	})
 
-	waitGroup.Wait()
+	if cache != nil {
+		err = cache.Save(optCache)
+	}
 
 	CompactUsage(usage, optMaxEntries, optMaxDepth)
 
-	err = tpl.Execute(f, map[string]any{
-		"Time":     time.Now().Format(time.DateTime),
-		"Hostname": rg.Must(os.Hostname()),
-		"Path":     rg.Must(filepath.Abs(optPath)),
-		"Usage":    usage,
-	})
+	displayPath := root
+	if abs, absErr := filepath.Abs(root); absErr == nil {
+		displayPath = abs
+	}
+
+	now := time.Now()
+	meta := format.Meta{
+		Time:     now.Format(time.DateTime),
+		UnixTime: now.Unix(),
+		Hostname: rg.Must(os.Hostname()),
+		Path:     displayPath,
+	}
+
+	var node *format.Node
+	for _, target := range optOutputs {
+		if err = writeOutput(target, tpl, usage, meta, &node); err != nil {
+			return
+		}
+	}
+}
+
+// writeOutput renders usage through the exporter selected by target.Type and
+// writes it to target.Dest ("-" means stdout). The html type keeps using the
+// existing template, since it carries page chrome the other formats don't
+// need; every other type goes through format.Exporter, converting usage to a
+// format.Node lazily and caching it in *node for reuse across targets.
+func writeOutput(target outputTarget, tpl *template.Template, usage *Usage, meta format.Meta, node **format.Node) error {
+	w, closeW, err := openOutputDest(target.Dest)
+	if err != nil {
+		return err
+	}
+	defer closeW()
+
+	if target.Type == "html" {
+		return tpl.Execute(w, map[string]any{
+			"Time":     meta.Time,
+			"Hostname": meta.Hostname,
+			"Path":     meta.Path,
+			"Usage":    usage,
+		})
+	}
+
+	exporter, ok := format.Get(target.Type)
+	if !ok {
+		return fmt.Errorf("unknown output type %q", target.Type)
+	}
+
+	if *node == nil {
+		*node = toFormatNode(usage)
+	}
+
+	return exporter.Export(w, *node, meta)
+}
+
+func openOutputDest(dest string) (io.Writer, func(), error) {
+	if dest == "-" {
+		return os.Stdout, func() {}, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { _ = f.Close() }, nil
+}
+
+func toFormatNode(usage *Usage) *format.Node {
+	node := &format.Node{
+		Name: usage.Name,
+		Size: usage.Size,
+	}
+	for _, entry := range usage.Entries {
+		entryNode := toFormatNode(entry)
+		entryNode.Parent = node
+		node.Entries = append(node.Entries, entryNode)
+	}
+	return node
 }
@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+// usageJob is one directory waiting to be walked.
+type usageJob struct {
+	Usage *Usage
+	Dir   string
+}
+
+// usageQueue is an unbounded FIFO queue of usageJobs, shared by a fixed pool
+// of workers. Pop blocks until a job is available or the queue is closed,
+// which is how workers learn there is no more work left and exit.
+type usageQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []*usageJob
+	closed bool
+}
+
+func newUsageQueue() *usageQueue {
+	q := &usageQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *usageQueue) Push(job *usageJob) {
+	q.mu.Lock()
+	q.items = append(q.items, job)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// Pop returns the next job, or ok=false once the queue has been closed and
+// drained.
+func (q *usageQueue) Pop() (job *usageJob, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+
+	job, q.items = q.items[0], q.items[1:]
+	return job, true
+}
+
+// Close unblocks every worker waiting on Pop once the queue is drained.
+func (q *usageQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
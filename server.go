@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/guoyk93/rg"
+
+	"github.com/guoyk93/duflame/backend"
+)
+
+// Server keeps a Usage tree resident in memory and serves it over HTTP,
+// walking subtrees one directory at a time as the UI asks for them instead
+// of pre-rendering the whole tree into a single HTML document up front.
+type Server struct {
+	mu       sync.RWMutex
+	root     *Usage
+	opts     CreateUsageOptions
+	tpl      *template.Template
+	hostname string
+	rootPath string
+}
+
+// NewServer wraps root for serving. opts is reused for every lazy walk, so
+// it must carry the same Backend and Cache the caller wants "serve" mode to
+// use for the lifetime of the process; opts.Dir is the backend path every
+// walk starts from, while rootPath is only shown on the index page.
+func NewServer(root *Usage, opts CreateUsageOptions, tpl *template.Template, hostname, rootPath string) *Server {
+	return &Server{root: root, opts: opts, tpl: tpl, hostname: hostname, rootPath: rootPath}
+}
+
+// Handler returns the http.Handler serving the index page and the two
+// drill-down endpoints, /api/usage and /api/rescan.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/usage", s.handleUsage)
+	mux.HandleFunc("/api/rescan", s.handleRescan)
+	return mux
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	if !s.root.walked {
+		_ = s.walkOneLevel(s.root, s.opts.Dir)
+	}
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	if err := s.tpl.Execute(w, map[string]any{
+		"Time":     now.Format(time.DateTime),
+		"Hostname": s.hostname,
+		"Path":     s.rootPath,
+		"Usage":    s.root,
+	}); err != nil {
+		log.Println("serve: failed to render index:", err)
+	}
+}
+
+// handleUsage returns the JSON subtree rooted at the "path" query param,
+// walking down to "depth" levels (default 1) of directories that have not
+// been walked yet. Already-walked directories are served straight from
+// memory, so repeated requests for the same path are cheap.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	if depth < 1 {
+		depth = 1
+	}
+
+	s.mu.Lock()
+	node, dir, err := s.locate(r.URL.Query().Get("path"))
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.walkDepth(node, dir, depth)
+	s.mu.Unlock()
+
+	s.writeNode(w, node)
+}
+
+// handleRescan discards whatever is cached for "path" and walks it fresh,
+// so the UI can recover from a directory that changed since it was last
+// read.
+func (s *Server) handleRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	node, dir, err := s.locate(r.URL.Query().Get("path"))
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if node.Parent != nil {
+		node.Parent.AddSize(-node.Size)
+	}
+	node.Size = 0
+	node.Entries = nil
+	node.walked = false
+	if s.opts.Cache != nil {
+		s.opts.Cache.Invalidate(dir)
+	}
+	err = s.walkOneLevel(node, dir)
+	s.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeNode(w, node)
+}
+
+func (s *Server) writeNode(w http.ResponseWriter, node *Usage) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(node); err != nil {
+		log.Println("serve: failed to encode response:", err)
+	}
+}
+
+// locate walks relPath (slash-separated, relative to the server root) from
+// s.root, creating placeholder, not-yet-walked Usage nodes for any segment
+// that has not been fetched before. It returns the node and the backend
+// directory it corresponds to, or an error if relPath tries to escape the
+// server root. Callers must hold s.mu for writing.
+func (s *Server) locate(relPath string) (node *Usage, dir string, err error) {
+	node, dir = s.root, s.opts.Dir
+
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" {
+		return node, dir, nil
+	}
+
+	for _, name := range strings.Split(relPath, "/") {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `\`) {
+			return nil, "", fmt.Errorf("invalid path segment %q", name)
+		}
+
+		dir = s.opts.Backend.Join(dir, name)
+
+		child := findChildUsage(node, name)
+		if child == nil {
+			child = &Usage{Parent: node, Name: name}
+			node.Entries = append(node.Entries, child)
+		}
+		node = child
+	}
+	return node, dir, nil
+}
+
+func findChildUsage(node *Usage, name string) *Usage {
+	for _, entry := range node.Entries {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// walkDepth fills node down to depth levels below it, walking only the
+// directories that have not been walked yet. Callers must hold s.mu.
+func (s *Server) walkDepth(node *Usage, dir string, depth int) {
+	if depth < 1 {
+		return
+	}
+
+	if !node.walked {
+		if err := s.walkOneLevel(node, dir); err != nil {
+			log.Println("serve: failed to read dir:", dir, err)
+			return
+		}
+	}
+
+	if depth == 1 {
+		return
+	}
+	for _, entry := range node.Entries {
+		s.walkDepth(entry, s.opts.Backend.Join(dir, entry.Name), depth-1)
+	}
+}
+
+// walkOneLevel reads a single directory's immediate children into node,
+// preferring the incremental cache above when it has a fresh record, and
+// storing a fresh record back into the cache otherwise so later requests
+// (and the cache file, once saved) pick it up. Callers must hold s.mu.
+func (s *Server) walkOneLevel(node *Usage, dir string) error {
+	ctx := context.Background()
+
+	var dirModTime time.Time
+	haveModTime := false
+	if s.opts.Cache != nil {
+		if info, err := s.opts.Backend.StatDir(ctx, dir); err == nil {
+			dirModTime, haveModTime = info.ModTime, true
+
+			if record, ok := s.opts.Cache.Lookup(dir, dirModTime); ok {
+				if record.fresh(ctx, s.opts.Backend, dir) {
+					for _, name := range record.ChildrenNames {
+						if size, isFile := record.PerFileSizes[name]; isFile {
+							node.AddSize(size)
+							continue
+						}
+						node.Entries = append(node.Entries, &Usage{Parent: node, Name: name})
+					}
+					node.walked = true
+					return nil
+				}
+				s.opts.Cache.Demote()
+			}
+		}
+	}
+
+	entries, err := s.opts.Backend.ReadDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	var record *CacheRecord
+	if s.opts.Cache != nil && haveModTime {
+		record = &CacheRecord{
+			Path:            dir,
+			DirModTime:      dirModTime,
+			PerFileSizes:    map[string]int64{},
+			PerFileModTimes: map[string]time.Time{},
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir {
+			node.Entries = append(node.Entries, &Usage{Parent: node, Name: entry.Name})
+			if record != nil {
+				record.ChildrenNames = append(record.ChildrenNames, entry.Name)
+			}
+			continue
+		}
+		node.AddSize(entry.Size)
+		if record != nil {
+			record.ChildrenNames = append(record.ChildrenNames, entry.Name)
+			record.PerFileSizes[entry.Name] = entry.Size
+			record.PerFileModTimes[entry.Name] = entry.ModTime
+		}
+	}
+	node.walked = true
+
+	if record != nil {
+		record.AggregatedSize = node.Size
+		s.opts.Cache.Store(record)
+	}
+	return nil
+}
+
+// runServe implements "duflame serve", keeping the process resident and
+// serving drill-down JSON instead of writing a single, fully-rendered
+// report.
+func runServe(args []string) {
+	var err error
+	defer func() {
+		if err == nil {
+			return
+		}
+		log.Println("exited with error:", err)
+		os.Exit(1)
+	}()
+	defer rg.Guard(&err)
+
+	var (
+		optAddr  string
+		optPath  string
+		optCache string
+		optForce bool
+	)
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&optAddr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&optPath, "C", ".", "directory path, or a backend URL such as file://path")
+	fs.StringVar(&optCache, "cache", "", "path to a cache file, enables incremental scanning of unchanged directories")
+	fs.BoolVar(&optForce, "force", false, "ignore the existing cache file and re-walk everything")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	tpl := buildTemplate()
+
+	bk, root, err := backend.Open(optPath)
+	if err != nil {
+		return
+	}
+
+	var cache *CacheStore
+	if optCache != "" {
+		if optForce {
+			cache = NewCacheStore()
+		} else {
+			cache = rg.Must(LoadCacheStore(optCache))
+		}
+	}
+
+	displayPath := root
+	if abs, absErr := filepath.Abs(root); absErr == nil {
+		displayPath = abs
+	}
+
+	srv := NewServer(
+		&Usage{Name: "[ROOT]"},
+		CreateUsageOptions{
+			Backend: bk,
+			Dir:     root,
+			Cache:   cache,
+		},
+		tpl,
+		rg.Must(os.Hostname()),
+		displayPath,
+	)
+
+	httpServer := &http.Server{Addr: optAddr, Handler: srv.Handler()}
+
+	// Flush whatever the cache has learned during this run back to disk on
+	// a clean shutdown. Unlike the one-shot mode, a serve session only ever
+	// visits the handful of directories the UI drilled into, so it saves
+	// with SaveAll rather than Save: evicting anything not touched this run
+	// would throw away every record the session never happened to click on.
+	if cache != nil {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-stop
+			log.Println("duflame: shutting down, saving cache")
+			if saveErr := cache.SaveAll(optCache); saveErr != nil {
+				log.Println("failed to save cache:", saveErr)
+			}
+			_ = httpServer.Close()
+		}()
+	}
+
+	log.Println("duflame: serving", displayPath, "on", optAddr)
+	if err = httpServer.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+}